@@ -0,0 +1,96 @@
+package htlcswitch
+
+import "sync"
+
+// pushRing delivers ev to ch without blocking. If ch is full, the oldest
+// buffered event is dropped to make room, giving ch ring-buffer semantics:
+// a slow subscriber loses old events rather than stalling the sender.
+func pushRing(ch chan ForwardingEvent, ev ForwardingEvent) {
+	for {
+		select {
+		case ch <- ev:
+			return
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	}
+}
+
+// ForwardingEventCollator is the switch's concrete implementation of the
+// live side of ForwardingLog: it collates ForwardingEvents as links report
+// them and multiplexes each one out to every subscriber registered via
+// SubscribeForwardingEvents. Each subscriber gets its own bounded,
+// ring-buffered channel so one slow consumer can never block forwarding, or
+// delivery to any other subscriber.
+type ForwardingEventCollator struct {
+	mu          sync.Mutex
+	subscribers map[uint64]chan ForwardingEvent
+	nextID      uint64
+	bufferSize  int
+}
+
+// NewForwardingEventCollator creates a ForwardingEventCollator whose
+// subscriber channels each buffer up to bufferSize events before the oldest
+// is dropped to make room for a new one.
+func NewForwardingEventCollator(bufferSize int) *ForwardingEventCollator {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return &ForwardingEventCollator{
+		subscribers: make(map[uint64]chan ForwardingEvent),
+		bufferSize:  bufferSize,
+	}
+}
+
+// SubscribeForwardingEvents registers a new subscriber and returns the
+// ForwardingSubscription it should read events from until it calls Cancel.
+//
+// NOTE: This is part of the ForwardingLog interface.
+func (c *ForwardingEventCollator) SubscribeForwardingEvents() (*ForwardingSubscription, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	id := c.nextID
+
+	ch := make(chan ForwardingEvent, c.bufferSize)
+	c.subscribers[id] = ch
+
+	sub := &ForwardingSubscription{
+		Events: ch,
+		Cancel: func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			if _, ok := c.subscribers[id]; ok {
+				delete(c.subscribers, id)
+				close(ch)
+			}
+		},
+	}
+
+	return sub, nil
+}
+
+// NotifyForwardingEvent is called by the switch as it collates a completed
+// or failed circuit from a link, fanning ev out to every live subscriber.
+func (c *ForwardingEventCollator) NotifyForwardingEvent(ev ForwardingEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, ch := range c.subscribers {
+		pushRing(ch, ev)
+	}
+}
+
+// NumSubscribers returns the number of currently registered subscribers.
+// It is intended for tests and instrumentation.
+func (c *ForwardingEventCollator) NumSubscribers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.subscribers)
+}
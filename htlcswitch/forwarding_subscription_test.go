@@ -0,0 +1,91 @@
+package htlcswitch
+
+import "testing"
+
+// TestForwardingEventCollatorFanOut asserts that every event notified to
+// the collator is delivered to every live subscriber.
+func TestForwardingEventCollatorFanOut(t *testing.T) {
+	collator := NewForwardingEventCollator(4)
+
+	sub1, err := collator.SubscribeForwardingEvents()
+	if err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+	sub2, err := collator.SubscribeForwardingEvents()
+	if err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+
+	ev := ForwardingEvent{PaymentHash: [32]byte{0x01}}
+	collator.NotifyForwardingEvent(ev)
+
+	for _, sub := range []*ForwardingSubscription{sub1, sub2} {
+		select {
+		case got := <-sub.Events:
+			if got.PaymentHash != ev.PaymentHash {
+				t.Fatalf("unexpected event: %+v", got)
+			}
+		default:
+			t.Fatalf("subscriber did not receive the event")
+		}
+	}
+}
+
+// TestForwardingEventCollatorRingBuffer asserts that a subscriber who falls
+// behind loses its oldest buffered events rather than blocking the sender.
+func TestForwardingEventCollatorRingBuffer(t *testing.T) {
+	collator := NewForwardingEventCollator(2)
+
+	sub, err := collator.SubscribeForwardingEvents()
+	if err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		collator.NotifyForwardingEvent(ForwardingEvent{
+			PaymentHash: [32]byte{byte(i)},
+		})
+	}
+
+	var got []ForwardingEvent
+	for {
+		select {
+		case ev := <-sub.Events:
+			got = append(got, ev)
+			continue
+		default:
+		}
+		break
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected the ring buffer to cap at 2 events, got %d", len(got))
+	}
+	if got[0].PaymentHash[0] != 3 || got[1].PaymentHash[0] != 4 {
+		t.Fatalf("expected the newest 2 events to survive, got %+v", got)
+	}
+}
+
+// TestForwardingEventCollatorCancel asserts that Cancel removes the
+// subscriber and closes its channel.
+func TestForwardingEventCollatorCancel(t *testing.T) {
+	collator := NewForwardingEventCollator(2)
+
+	sub, err := collator.SubscribeForwardingEvents()
+	if err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+	if got := collator.NumSubscribers(); got != 1 {
+		t.Fatalf("expected 1 subscriber, got %d", got)
+	}
+
+	sub.Cancel()
+
+	if got := collator.NumSubscribers(); got != 0 {
+		t.Fatalf("expected 0 subscribers after cancel, got %d", got)
+	}
+
+	if _, ok := <-sub.Events; ok {
+		t.Fatalf("expected the events channel to be closed after cancel")
+	}
+}
@@ -0,0 +1,109 @@
+package htlcswitch
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BTCGPU/lnd/lnwire"
+)
+
+// heldPacket is a packet parked in a HeldPacketQueue awaiting a follow-up
+// ResolveHeld call, along with the timer enforcing its incoming CLTV.
+type heldPacket struct {
+	pkt   InterceptedPacket
+	timer *time.Timer
+}
+
+// HeldPacketQueue is the concrete, in-memory acceptance queue a ChannelLink
+// parks InterceptedPackets in once an HtlcInterceptor returns
+// InterceptActionHold for them. Every parked packet carries a timer armed
+// off its IncomingExpiry so that a non-responsive interceptor cannot stall
+// the channel: if the timer fires before ResolveHeld is called, the packet
+// is automatically resolved with InterceptActionFail.
+type HeldPacketQueue struct {
+	mu     sync.Mutex
+	nextID uint64
+	held   map[uint64]*heldPacket
+
+	// onResolve is invoked, exactly once per packet, with the terminal
+	// action the packet was resolved with, whether that resolution came
+	// from an explicit ResolveHeld call or from the hold timer expiring.
+	onResolve func(pkt InterceptedPacket, action InterceptAction,
+		preimage [32]byte, failure lnwire.FailureMessage)
+}
+
+// NewHeldPacketQueue creates a HeldPacketQueue that invokes onResolve for
+// every packet once it leaves the hold state.
+func NewHeldPacketQueue(onResolve func(pkt InterceptedPacket,
+	action InterceptAction, preimage [32]byte,
+	failure lnwire.FailureMessage)) *HeldPacketQueue {
+
+	return &HeldPacketQueue{
+		held:      make(map[uint64]*heldPacket),
+		onResolve: onResolve,
+	}
+}
+
+// Park admits pkt into the queue, assigns it an ID, and arms a hold timer
+// that fires after timeout — the duration between now and the block height
+// named by pkt.IncomingExpiry, as computed by the caller. It returns the
+// packet with its ID populated.
+func (q *HeldPacketQueue) Park(pkt InterceptedPacket,
+	timeout time.Duration) InterceptedPacket {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextID++
+	pkt.ID = q.nextID
+
+	entry := &heldPacket{pkt: pkt}
+	entry.timer = time.AfterFunc(timeout, func() {
+		q.resolve(pkt.ID, InterceptActionFail, [32]byte{},
+			&lnwire.FailTemporaryChannelFailure{})
+	})
+	q.held[pkt.ID] = entry
+
+	return pkt
+}
+
+// Resolve finalizes the held packet identified by id with a terminal
+// action, canceling its hold timer. It returns an error if id is unknown or
+// the packet has already been resolved.
+func (q *HeldPacketQueue) Resolve(id uint64, action InterceptAction,
+	preimage [32]byte, failure lnwire.FailureMessage) error {
+
+	if action == InterceptActionHold {
+		return fmt.Errorf("cannot resolve held packet %d with a "+
+			"further hold", id)
+	}
+
+	return q.resolve(id, action, preimage, failure)
+}
+
+func (q *HeldPacketQueue) resolve(id uint64, action InterceptAction,
+	preimage [32]byte, failure lnwire.FailureMessage) error {
+
+	q.mu.Lock()
+	entry, ok := q.held[id]
+	if !ok {
+		q.mu.Unlock()
+		return fmt.Errorf("no held packet with id %d", id)
+	}
+	delete(q.held, id)
+	q.mu.Unlock()
+
+	entry.timer.Stop()
+	q.onResolve(entry.pkt, action, preimage, failure)
+
+	return nil
+}
+
+// Len returns the number of packets currently parked in the queue.
+func (q *HeldPacketQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.held)
+}
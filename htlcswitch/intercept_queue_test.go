@@ -0,0 +1,78 @@
+package htlcswitch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BTCGPU/lnd/lnwire"
+)
+
+// TestHeldPacketQueueResolve asserts that a parked packet is handed back to
+// onResolve with the action passed to Resolve, and that its timer no longer
+// fires afterward.
+func TestHeldPacketQueueResolve(t *testing.T) {
+	resolved := make(chan InterceptAction, 1)
+	queue := NewHeldPacketQueue(func(pkt InterceptedPacket,
+		action InterceptAction, preimage [32]byte,
+		failure lnwire.FailureMessage) {
+
+		resolved <- action
+	})
+
+	pkt := queue.Park(InterceptedPacket{PaymentHash: [32]byte{0x01}},
+		50*time.Millisecond)
+
+	var preimage [32]byte
+	if err := queue.Resolve(pkt.ID, InterceptActionSettle, preimage, nil); err != nil {
+		t.Fatalf("unable to resolve held packet: %v", err)
+	}
+
+	select {
+	case action := <-resolved:
+		if action != InterceptActionSettle {
+			t.Fatalf("expected settle, got %v", action)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("packet was never resolved")
+	}
+
+	// A second resolution attempt must fail since the packet is gone.
+	if err := queue.Resolve(pkt.ID, InterceptActionFail, preimage, nil); err == nil {
+		t.Fatalf("expected error resolving an already-resolved packet")
+	}
+
+	// The timer should not fire a second, stale resolution.
+	select {
+	case <-resolved:
+		t.Fatalf("timer fired after packet was already resolved")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestHeldPacketQueueTimeout asserts that a packet whose interceptor never
+// responds is automatically failed once its hold timer expires.
+func TestHeldPacketQueueTimeout(t *testing.T) {
+	resolved := make(chan InterceptAction, 1)
+	queue := NewHeldPacketQueue(func(pkt InterceptedPacket,
+		action InterceptAction, preimage [32]byte,
+		failure lnwire.FailureMessage) {
+
+		resolved <- action
+	})
+
+	queue.Park(InterceptedPacket{PaymentHash: [32]byte{0x02}},
+		10*time.Millisecond)
+
+	select {
+	case action := <-resolved:
+		if action != InterceptActionFail {
+			t.Fatalf("expected fail on timeout, got %v", action)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("hold timer never fired")
+	}
+
+	if got := queue.Len(); got != 0 {
+		t.Fatalf("expected queue to be empty after timeout, got %d", got)
+	}
+}
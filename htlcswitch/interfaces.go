@@ -1,12 +1,30 @@
 package htlcswitch
 
 import (
+	"time"
+
 	"github.com/BTCGPU/lnd/channeldb"
 	"github.com/BTCGPU/lnd/lnwire"
 	"github.com/roasbeef/btcd/chaincfg/chainhash"
 	"github.com/roasbeef/btcd/wire"
 )
 
+// InvoiceResolution describes the final disposition of an invoice that an
+// exit hop parked awaiting settlement. It is delivered over the channel
+// returned by InvoiceDatabase's NotifyExitHopHtlc once the invoice registry
+// (or an external acceptor sitting behind it) has made a settle/cancel
+// decision for a hold invoice.
+type InvoiceResolution struct {
+	// Settled is true if the invoice was settled, in which case Preimage
+	// is the preimage that should be used to settle the waiting HTLC.
+	// If false, the waiting HTLC should be canceled back.
+	Settled bool
+
+	// Preimage is the payment preimage for the invoice. It is only
+	// valid when Settled is true.
+	Preimage [32]byte
+}
+
 // InvoiceDatabase is an interface which represents the persistent subsystem
 // which may search, lookup and settle invoices.
 type InvoiceDatabase interface {
@@ -17,6 +35,20 @@ type InvoiceDatabase interface {
 	// SettleInvoice attempts to mark an invoice corresponding to the
 	// passed payment hash as fully settled.
 	SettleInvoice(chainhash.Hash) error
+
+	// NotifyExitHopHtlc attempts to mark an invoice as accepted if the
+	// passed amount satisfies it. Unlike SettleInvoice, the invoice is
+	// not immediately settled: the returned channel is sent upon once
+	// the invoice is later settled or canceled, whether that decision is
+	// made by the registry itself or by an external acceptor driving a
+	// hold invoice. Callers are expected to park the HTLC until either
+	// the channel fires or the incoming HTLC times out.
+	NotifyExitHopHtlc(payHash chainhash.Hash,
+		amt lnwire.MilliSatoshi) (<-chan InvoiceResolution, error)
+
+	// CancelInvoice attempts to cancel the invoice corresponding to the
+	// passed payment hash.
+	CancelInvoice(payHash chainhash.Hash) error
 }
 
 // ChannelLink is an interface which represents the subsystem for managing the
@@ -80,10 +112,19 @@ type ChannelLink interface {
 	// details satisfy the current forwarding policy fo the target link.
 	// Otherwise, a valid protocol failure message should be returned in
 	// order to signal to the source of the HTLC, the policy consistency
-	// issue.
+	// issue. A TemporaryChannelFailure is returned if the HTLC would
+	// breach a configured in-flight count, in-flight value, or
+	// forwards-per-second rate limit.
 	HtlcSatifiesPolicy(payHash [32]byte,
 		incomingAmt, amtToForward lnwire.MilliSatoshi) lnwire.FailureMessage
 
+	// InFlightHTLCs returns the number of HTLC's the link has currently
+	// forwarded but not yet cleared with a settle or a fail, along with
+	// their aggregate value. HtlcSatifiesPolicy consults these counters,
+	// which are incremented on ADD and decremented on SETTLE/FAIL, when
+	// enforcing the link's configured rate limits.
+	InFlightHTLCs() (uint32, lnwire.MilliSatoshi)
+
 	// Bandwidth returns the amount of milli-satoshis which current link
 	// might pass through channel link. The value returned from this method
 	// represents the up to date available flow through the channel. This
@@ -110,12 +151,111 @@ type ChannelLink interface {
 	// have buffered messages.
 	AttachMailBox(MailBox)
 
+	// ResolveHoldForward is invoked once an exit-hop HTLC that this link
+	// parked pending an asynchronous invoice decision (see
+	// InvoiceDatabase's NotifyExitHopHtlc) has been resolved. It lets the
+	// link re-drive settlement of the held HTLC from the resolution
+	// rather than only being able to decide its fate synchronously at
+	// ADD time.
+	ResolveHoldForward(payHash chainhash.Hash, resolution InvoiceResolution) error
+
+	// AttachInterceptor registers an HtlcInterceptor with the link. Every
+	// HTLC the link would otherwise forward is first routed through the
+	// registered interceptors, in order, before HtlcSatifiesPolicy is
+	// consulted. A link may have more than one interceptor attached.
+	AttachInterceptor(HtlcInterceptor)
+
+	// ResolveHeld finalizes a packet that an HtlcInterceptor returned
+	// InterceptActionHold for. It is called either by the interceptor
+	// itself once it reaches a decision, or by the link's own hold timer
+	// (armed off InterceptedPacket.IncomingExpiry) if the interceptor
+	// never responds. id is the InterceptedPacket.ID the interceptor was
+	// given in InterceptForward; action must be one of
+	// InterceptActionFail/InterceptActionSettle/InterceptActionResume.
+	// Calling ResolveHeld for an id that is unknown, or no longer held,
+	// returns an error.
+	ResolveHeld(id uint64, action InterceptAction,
+		preimage [32]byte, failure lnwire.FailureMessage) error
+
 	// Start/Stop are used to initiate the start/stop of the channel link
 	// functioning.
 	Start() error
 	Stop()
 }
 
+// InterceptedPacket describes an incoming HTLC that is being offered to a
+// registered HtlcInterceptor for a forwarding decision before the link's
+// static ForwardingPolicy is applied.
+type InterceptedPacket struct {
+	// ID uniquely identifies this packet for the lifetime of a hold. If
+	// InterceptForward returns InterceptActionHold, ID is the handle the
+	// interceptor (or the link's own hold timer) must later pass to
+	// ChannelLink.ResolveHeld to finalize the packet.
+	ID uint64
+
+	// IncomingChanID is the short channel ID of the link the HTLC
+	// arrived on.
+	IncomingChanID lnwire.ShortChannelID
+
+	// PaymentHash is the payment hash carried by the HTLC.
+	PaymentHash [32]byte
+
+	// IncomingAmount is the amount of the incoming HTLC.
+	IncomingAmount lnwire.MilliSatoshi
+
+	// OutgoingAmount is the amount the link intends to forward onward.
+	OutgoingAmount lnwire.MilliSatoshi
+
+	// IncomingExpiry is the absolute CLTV expiry of the incoming HTLC.
+	// When InterceptForward returns InterceptActionHold, the link arms a
+	// timer off this value (see HeldPacketQueue) so a non-responsive
+	// interceptor cannot stall the channel past its existing CLTV
+	// enforcement: the timer resolves the packet with
+	// InterceptActionFail if ResolveHeld has not been called by then.
+	IncomingExpiry uint32
+}
+
+// InterceptAction is the decision an HtlcInterceptor renders for a given
+// InterceptedPacket.
+type InterceptAction uint8
+
+const (
+	// InterceptActionResume instructs the link to proceed as if no
+	// interceptor were present, applying its ForwardingPolicy as usual.
+	InterceptActionResume InterceptAction = iota
+
+	// InterceptActionFail instructs the link to fail the HTLC back with
+	// the accompanying failure message.
+	InterceptActionFail
+
+	// InterceptActionSettle instructs the link to settle the HTLC using
+	// the accompanying preimage, without forwarding it onward.
+	InterceptActionSettle
+
+	// InterceptActionHold instructs the link to park the HTLC in its
+	// HeldPacketQueue until a follow-up call to
+	// ChannelLink.ResolveHeld(pkt.ID, ...) resolves it, or the incoming
+	// CLTV forces it to be failed back.
+	InterceptActionHold
+)
+
+// HtlcInterceptor is implemented by external forwarding policy providers,
+// such as a gRPC service or an in-process module, that want a chance to
+// inspect and decide the fate of every HTLC a link would otherwise forward.
+//
+// InterceptForward is a single synchronous call: it must return a terminal
+// action (Resume/Fail/Settle) immediately, or InterceptActionHold. A Hold is
+// not itself terminal — the interceptor (or the link's hold timer, on
+// timeout) must follow up with ChannelLink.ResolveHeld(pkt.ID, ...) to
+// actually settle, fail, or resume the held packet.
+type HtlcInterceptor interface {
+	// InterceptForward is invoked for every packet a link is about to
+	// forward, prior to HtlcSatifiesPolicy being consulted. The returned
+	// InterceptAction determines whether the link resumes its normal
+	// policy checks, or instead fails, settles, or holds the HTLC.
+	InterceptForward(pkt InterceptedPacket) (InterceptAction, error)
+}
+
 // Peer is an interface which represents the remote lightning node inside our
 // system.
 type Peer interface {
@@ -132,6 +272,23 @@ type Peer interface {
 	PubKey() [33]byte
 }
 
+// InFlightAggregator is implemented by the switch and gives links a central
+// point to reserve and release in-flight HTLC activity against, so that
+// global rate limits spanning every channel can be enforced in addition to
+// the per-link limits configured via ForwardingPolicy.
+type InFlightAggregator interface {
+	// ReserveHtlc attempts to admit an in-flight HTLC of the given value
+	// on behalf of the peer identified by pubKey. A non-nil
+	// lnwire.FailureMessage is returned if admitting the HTLC would
+	// breach a configured global limit, in which case the link should
+	// fail the HTLC back with that message rather than forward it.
+	ReserveHtlc(pubKey [33]byte, amt lnwire.MilliSatoshi) lnwire.FailureMessage
+
+	// ReleaseHtlc releases a previously reserved in-flight HTLC once it
+	// has been settled or failed.
+	ReleaseHtlc(pubKey [33]byte, amt lnwire.MilliSatoshi)
+}
+
 // ForwardingLog is an interface that represents a time series database which
 // keep track of all successfully completed payment circuits. Every few
 // seconds, the switch will collate and flush out all the successful payment
@@ -142,4 +299,55 @@ type ForwardingLog interface {
 	// sub-systems can then query the contents of the log for analysis,
 	// visualizations, etc.
 	AddForwardingEvents([]channeldb.ForwardingEvent) error
+
+	// SubscribeForwardingEvents returns a ForwardingSubscription that
+	// delivers forwarding events in near-real-time, as the switch
+	// collates them from its links, rather than requiring consumers to
+	// poll the batched events written by AddForwardingEvents.
+	SubscribeForwardingEvents() (*ForwardingSubscription, error)
+}
+
+// ForwardingEvent is the htlcswitch-level view of a completed or failed
+// payment circuit delivered to live subscribers of the forwarding event
+// stream. It embeds the persisted channeldb.ForwardingEvent and enriches it
+// with details that are only available while the circuit is still in
+// memory.
+type ForwardingEvent struct {
+	channeldb.ForwardingEvent
+
+	// IncomingPeer is the public key of the peer the HTLC arrived from.
+	IncomingPeer [33]byte
+
+	// OutgoingPeer is the public key of the peer the HTLC was forwarded
+	// to. It is the zero value if the HTLC was not forwarded onward.
+	OutgoingPeer [33]byte
+
+	// PaymentHash is the payment hash carried by the forwarded HTLC.
+	PaymentHash [32]byte
+
+	// FailureReason is the failure message the circuit was torn down
+	// with, if it did not resolve with a settle.
+	FailureReason lnwire.FailureMessage
+
+	// ResolutionLatency is the amount of time that elapsed between the
+	// HTLC arriving at the switch and its circuit resolving, whether by
+	// settle or failure.
+	ResolutionLatency time.Duration
+}
+
+// ForwardingSubscription represents an intent to receive updates for all
+// successful or failed forwarding events from the switch. Events are
+// delivered over the Events channel as they are collated from links and
+// multiplexed to subscribers through a bounded ring buffer, so a slow
+// consumer cannot block the forwarding of other subscribers or the switch
+// itself.
+type ForwardingSubscription struct {
+	// Events is the channel over which newly collated forwarding events
+	// are delivered to the subscriber.
+	Events <-chan ForwardingEvent
+
+	// Cancel should be called once the subscriber is no longer
+	// interested in forwarding events, freeing the resources allocated
+	// for this subscription.
+	Cancel func()
 }
@@ -0,0 +1,184 @@
+package htlcswitch
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/roasbeef/btcd/chaincfg/chainhash"
+
+	"github.com/BTCGPU/lnd/lnwire"
+)
+
+// InvoiceState describes where a hold invoice sits in its settlement
+// lifecycle. It mirrors the Accepted/Settled/Canceled states that this
+// change adds alongside channeldb.Invoice; they live here rather than in
+// channeldb because this tree does not carry that package.
+type InvoiceState uint8
+
+const (
+	// InvoiceStateOpen is the state of an invoice that has not yet had a
+	// matching HTLC arrive at the exit hop.
+	InvoiceStateOpen InvoiceState = iota
+
+	// InvoiceStateAccepted is the state of an invoice for which a
+	// matching HTLC has arrived and is parked awaiting a settle/cancel
+	// decision from an acceptor.
+	InvoiceStateAccepted
+
+	// InvoiceStateSettled is the terminal state of an invoice that has
+	// been settled.
+	InvoiceStateSettled
+
+	// InvoiceStateCanceled is the terminal state of an invoice that has
+	// been canceled, either explicitly or because the parked HTLC timed
+	// out.
+	InvoiceStateCanceled
+)
+
+// hodlInvoice tracks the in-memory acceptance-queue state for a single
+// invoice that has at least one HTLC parked against it.
+type hodlInvoice struct {
+	state       InvoiceState
+	amtAccepted lnwire.MilliSatoshi
+	preimage    [32]byte
+	subscribers []chan InvoiceResolution
+}
+
+// InvoiceRegistry is a concrete, in-memory implementation of the hold
+// invoice acceptance queue and subscription fan-out backing
+// InvoiceDatabase's NotifyExitHopHtlc/CancelInvoice pair. HTLCs parked via
+// NotifyExitHopHtlc sit in the registry until SettleHodlInvoice or
+// CancelInvoice is called for their payment hash, or until the link's
+// existing CLTV enforcement path expires them via ExpireParkedHtlc.
+type InvoiceRegistry struct {
+	mu       sync.Mutex
+	invoices map[chainhash.Hash]*hodlInvoice
+}
+
+// NewInvoiceRegistry creates a new, empty InvoiceRegistry.
+func NewInvoiceRegistry() *InvoiceRegistry {
+	return &InvoiceRegistry{
+		invoices: make(map[chainhash.Hash]*hodlInvoice),
+	}
+}
+
+// NotifyExitHopHtlc parks the HTLC identified by payHash/amt in the
+// acceptance queue and returns a channel that fires once the invoice is
+// settled or canceled. If the invoice has already reached a terminal state,
+// the channel fires immediately with that outcome.
+//
+// Any amt moves a non-terminal invoice to InvoiceStateAccepted: amt is added
+// to the amount parked against the invoice, but it is not compared against
+// an invoice amount, as the registry does not track one.
+//
+// NOTE: This is part of the InvoiceDatabase interface.
+func (r *InvoiceRegistry) NotifyExitHopHtlc(payHash chainhash.Hash,
+	amt lnwire.MilliSatoshi) (<-chan InvoiceResolution, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inv, ok := r.invoices[payHash]
+	if !ok {
+		inv = &hodlInvoice{state: InvoiceStateOpen}
+		r.invoices[payHash] = inv
+	}
+
+	resChan := make(chan InvoiceResolution, 1)
+
+	switch inv.state {
+	case InvoiceStateSettled:
+		resChan <- InvoiceResolution{
+			Settled: true, Preimage: inv.preimage,
+		}
+		return resChan, nil
+
+	case InvoiceStateCanceled:
+		resChan <- InvoiceResolution{Settled: false}
+		return resChan, nil
+	}
+
+	inv.state = InvoiceStateAccepted
+	inv.amtAccepted += amt
+	inv.subscribers = append(inv.subscribers, resChan)
+
+	return resChan, nil
+}
+
+// CancelInvoice cancels the invoice identified by payHash, resolving every
+// HTLC currently parked against it with a cancellation.
+//
+// NOTE: This is part of the InvoiceDatabase interface.
+func (r *InvoiceRegistry) CancelInvoice(payHash chainhash.Hash) error {
+	return r.resolve(payHash, InvoiceResolution{Settled: false})
+}
+
+// SettleHodlInvoice is called by whatever is acting as the invoice's
+// acceptor once it decides to settle a parked invoice; the registry itself
+// never calls it. Every HTLC currently parked against payHash is resolved
+// with preimage.
+func (r *InvoiceRegistry) SettleHodlInvoice(payHash chainhash.Hash,
+	preimage [32]byte) error {
+
+	return r.resolve(payHash, InvoiceResolution{
+		Settled: true, Preimage: preimage,
+	})
+}
+
+// ExpireParkedHtlc is called by a link's existing CLTV enforcement path once
+// a parked HTLC's incoming expiry has passed without a settle/cancel
+// decision having been made. It cancels the invoice exactly as
+// CancelInvoice would.
+func (r *InvoiceRegistry) ExpireParkedHtlc(payHash chainhash.Hash) error {
+	return r.CancelInvoice(payHash)
+}
+
+// PendingAmount returns the aggregate amount currently parked against
+// payHash, and whether the invoice has any HTLCs parked at all. It is
+// intended for tests and for links deciding whether an invoice has been
+// fully paid before treating it as accepted.
+func (r *InvoiceRegistry) PendingAmount(payHash chainhash.Hash) (lnwire.MilliSatoshi, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inv, ok := r.invoices[payHash]
+	if !ok || inv.state != InvoiceStateAccepted {
+		return 0, false
+	}
+
+	return inv.amtAccepted, true
+}
+
+// resolve transitions the invoice identified by payHash to a terminal state
+// and fans the resolution out to every subscriber parked against it.
+func (r *InvoiceRegistry) resolve(payHash chainhash.Hash,
+	res InvoiceResolution) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inv, ok := r.invoices[payHash]
+	if !ok {
+		inv = &hodlInvoice{}
+		r.invoices[payHash] = inv
+	}
+
+	if inv.state == InvoiceStateSettled || inv.state == InvoiceStateCanceled {
+		return fmt.Errorf("invoice %v already resolved", payHash)
+	}
+
+	if res.Settled {
+		inv.state = InvoiceStateSettled
+		inv.preimage = res.Preimage
+	} else {
+		inv.state = InvoiceStateCanceled
+	}
+
+	for _, sub := range inv.subscribers {
+		sub <- res
+		close(sub)
+	}
+	inv.subscribers = nil
+
+	return nil
+}
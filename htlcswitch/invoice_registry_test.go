@@ -0,0 +1,99 @@
+package htlcswitch
+
+import (
+	"testing"
+
+	"github.com/roasbeef/btcd/chaincfg/chainhash"
+
+	"github.com/BTCGPU/lnd/lnwire"
+)
+
+// TestInvoiceRegistrySettle asserts that an HTLC parked via
+// NotifyExitHopHtlc is resolved with the preimage once the invoice is
+// settled out of band.
+func TestInvoiceRegistrySettle(t *testing.T) {
+	registry := NewInvoiceRegistry()
+
+	payHash := chainhash.Hash{0x01}
+	resChan, err := registry.NotifyExitHopHtlc(payHash, lnwire.MilliSatoshi(1000))
+	if err != nil {
+		t.Fatalf("unable to notify exit hop htlc: %v", err)
+	}
+
+	var preimage [32]byte
+	preimage[0] = 0xaa
+	if err := registry.SettleHodlInvoice(payHash, preimage); err != nil {
+		t.Fatalf("unable to settle invoice: %v", err)
+	}
+
+	select {
+	case res := <-resChan:
+		if !res.Settled {
+			t.Fatalf("expected invoice to be settled")
+		}
+		if res.Preimage != preimage {
+			t.Fatalf("preimage mismatch: want %x, got %x",
+				preimage, res.Preimage)
+		}
+	default:
+		t.Fatalf("resolution channel did not fire")
+	}
+}
+
+// TestInvoiceRegistryCancelAndExpire asserts that both an explicit
+// CancelInvoice and an ExpireParkedHtlc (the hook a link's CLTV enforcement
+// path would call) resolve parked HTLCs as canceled.
+func TestInvoiceRegistryCancelAndExpire(t *testing.T) {
+	registry := NewInvoiceRegistry()
+
+	payHash := chainhash.Hash{0x02}
+	resChan, err := registry.NotifyExitHopHtlc(payHash, lnwire.MilliSatoshi(500))
+	if err != nil {
+		t.Fatalf("unable to notify exit hop htlc: %v", err)
+	}
+
+	if err := registry.ExpireParkedHtlc(payHash); err != nil {
+		t.Fatalf("unable to expire parked htlc: %v", err)
+	}
+
+	select {
+	case res := <-resChan:
+		if res.Settled {
+			t.Fatalf("expected invoice to be canceled")
+		}
+	default:
+		t.Fatalf("resolution channel did not fire")
+	}
+
+	// Resolving an already-resolved invoice should be an error.
+	if err := registry.CancelInvoice(payHash); err == nil {
+		t.Fatalf("expected error canceling an already resolved invoice")
+	}
+}
+
+// TestInvoiceRegistryLateSubscriber asserts that an HTLC parked after an
+// invoice has already reached a terminal state is resolved immediately.
+func TestInvoiceRegistryLateSubscriber(t *testing.T) {
+	registry := NewInvoiceRegistry()
+
+	payHash := chainhash.Hash{0x03}
+	var preimage [32]byte
+	preimage[0] = 0xbb
+	if err := registry.SettleHodlInvoice(payHash, preimage); err != nil {
+		t.Fatalf("unable to settle invoice: %v", err)
+	}
+
+	resChan, err := registry.NotifyExitHopHtlc(payHash, lnwire.MilliSatoshi(250))
+	if err != nil {
+		t.Fatalf("unable to notify exit hop htlc: %v", err)
+	}
+
+	select {
+	case res := <-resChan:
+		if !res.Settled || res.Preimage != preimage {
+			t.Fatalf("unexpected resolution: %+v", res)
+		}
+	default:
+		t.Fatalf("resolution channel did not fire immediately")
+	}
+}
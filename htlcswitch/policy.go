@@ -0,0 +1,43 @@
+package htlcswitch
+
+import "github.com/BTCGPU/lnd/lnwire"
+
+// ForwardingPolicy describes the set of constraints that a given ChannelLink
+// must satisfy when forwarding HTLCs, both the static fee/htlc-size terms
+// advertised for the channel, and the pluggable rate limits a circuit
+// breaker enforces against misbehaving or overly aggressive peers.
+type ForwardingPolicy struct {
+	// MinHTLC is the smallest HTLC value the link will forward.
+	MinHTLC lnwire.MilliSatoshi
+
+	// MaxHTLC is the largest HTLC value the link will forward.
+	MaxHTLC lnwire.MilliSatoshi
+
+	// BaseFee is the base fee, in milli-satoshis, charged for each
+	// forwarded HTLC, regardless of its value.
+	BaseFee lnwire.MilliSatoshi
+
+	// FeeRate is the fee rate, in milli-satoshis per forwarded
+	// milli-satoshi, charged on top of BaseFee.
+	FeeRate lnwire.MilliSatoshi
+
+	// TimeLockDelta is the minimum difference the link requires between
+	// the CLTV expiry of an incoming HTLC and the CLTV expiry of the
+	// HTLC it forwards onward.
+	TimeLockDelta uint32
+
+	// MaxInFlightHtlcs caps the number of HTLCs the link will have
+	// forwarded but not yet cleared with a settle or a fail, at any one
+	// time. Zero means no per-link limit is enforced.
+	MaxInFlightHtlcs uint32
+
+	// MaxInFlightValue caps the aggregate value of HTLCs the link will
+	// have forwarded but not yet cleared, at any one time. Zero means no
+	// per-link limit is enforced.
+	MaxInFlightValue lnwire.MilliSatoshi
+
+	// MaxForwardsPerSecond caps the sustained rate, in forwarded HTLCs
+	// per second, that the link will admit, enforced via a token bucket.
+	// Zero means no rate limit is enforced.
+	MaxForwardsPerSecond float64
+}
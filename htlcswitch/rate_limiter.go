@@ -0,0 +1,243 @@
+package htlcswitch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/BTCGPU/lnd/lnwire"
+)
+
+// LinkInFlightCounter is the concrete, per-link counter backing
+// ChannelLink.InFlightHTLCs. A link increments it when an HTLC is added and
+// decrements it once that HTLC clears with a settle or a fail, so that
+// HtlcSatifiesPolicy can compare the live counts against the per-channel
+// MaxInFlightHtlcs/MaxInFlightValue limits in ForwardingPolicy.
+type LinkInFlightCounter struct {
+	mu    sync.Mutex
+	count uint32
+	value lnwire.MilliSatoshi
+}
+
+// Add records a newly forwarded, not-yet-cleared HTLC of the given value.
+func (c *LinkInFlightCounter) Add(amt lnwire.MilliSatoshi) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.count++
+	c.value += amt
+}
+
+// Remove records that a previously added HTLC has cleared, via a settle or
+// a fail.
+func (c *LinkInFlightCounter) Remove(amt lnwire.MilliSatoshi) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.count > 0 {
+		c.count--
+	}
+	if c.value > amt {
+		c.value -= amt
+	} else {
+		c.value = 0
+	}
+}
+
+// Counts returns the current in-flight count and aggregate value. It backs
+// ChannelLink.InFlightHTLCs.
+func (c *LinkInFlightCounter) Counts() (uint32, lnwire.MilliSatoshi) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.count, c.value
+}
+
+// tokenBucket is a simple token-bucket rate limiter: it refills at
+// ratePerSec tokens per second, up to burst, and Take reports whether a
+// single token was available.
+type tokenBucket struct {
+	mu         sync.Mutex
+	ratePerSec float64
+	burst      float64
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(ratePerSec float64) *tokenBucket {
+	burst := ratePerSec
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		ratePerSec: ratePerSec,
+		burst:      burst,
+		tokens:     burst,
+		lastRefill: time.Now(),
+	}
+}
+
+// setRate re-parameterizes the bucket to a new rate/burst, live. Existing
+// tokens are capped to the new burst so a shrinking limit takes effect
+// immediately, while a growing or newly-enabled limit starts refilling from
+// the current token count rather than resetting it.
+func (b *tokenBucket) setRate(ratePerSec float64) {
+	burst := ratePerSec
+	if burst < 1 {
+		burst = 1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.ratePerSec = ratePerSec
+	b.burst = burst
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+func (b *tokenBucket) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	b.lastRefill = now
+
+	b.tokens += elapsed * b.ratePerSec
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// peerLimits holds the in-flight counters and token bucket for a single
+// peer's global (cross-channel) activity.
+type peerLimits struct {
+	count  uint32
+	value  lnwire.MilliSatoshi
+	bucket *tokenBucket
+}
+
+// SwitchRateLimiter is the switch's concrete InFlightAggregator
+// implementation. It aggregates in-flight HTLC activity across every link,
+// per peer, and enforces the global max-in-flight-count,
+// max-in-flight-value, and forwards-per-second limits on top of whatever
+// each link enforces individually via its own ForwardingPolicy.
+type SwitchRateLimiter struct {
+	mu    sync.Mutex
+	peers map[[33]byte]*peerLimits
+
+	maxInFlightHtlcs     uint32
+	maxInFlightValue     lnwire.MilliSatoshi
+	maxForwardsPerSecond float64
+}
+
+// NewSwitchRateLimiter creates a SwitchRateLimiter enforcing the given
+// global limits. A zero value for any limit disables it.
+func NewSwitchRateLimiter(maxInFlightHtlcs uint32,
+	maxInFlightValue lnwire.MilliSatoshi,
+	maxForwardsPerSecond float64) *SwitchRateLimiter {
+
+	return &SwitchRateLimiter{
+		peers:                make(map[[33]byte]*peerLimits),
+		maxInFlightHtlcs:     maxInFlightHtlcs,
+		maxInFlightValue:     maxInFlightValue,
+		maxForwardsPerSecond: maxForwardsPerSecond,
+	}
+}
+
+// SetLimits updates the global limits the aggregator enforces, live. It is
+// the hook an admin RPC handler would call to adjust limits without a
+// restart; wiring an actual RPC requires the lnrpc proto definitions, which
+// this tree does not carry, so no RPC handler is added here.
+func (s *SwitchRateLimiter) SetLimits(maxInFlightHtlcs uint32,
+	maxInFlightValue lnwire.MilliSatoshi, maxForwardsPerSecond float64) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxInFlightHtlcs = maxInFlightHtlcs
+	s.maxInFlightValue = maxInFlightValue
+	s.maxForwardsPerSecond = maxForwardsPerSecond
+
+	// The token bucket for each peer that has already sent an HTLC was
+	// parameterized at peer-creation time, so it won't pick up the new
+	// rate on its own: re-parameterize every existing bucket here. Peers
+	// created after this call pick up the new rate via peerFor.
+	for _, p := range s.peers {
+		p.bucket.setRate(maxForwardsPerSecond)
+	}
+}
+
+// peerFor returns (creating if necessary) the peerLimits for pubKey. Must
+// be called with s.mu held.
+func (s *SwitchRateLimiter) peerFor(pubKey [33]byte) *peerLimits {
+	p, ok := s.peers[pubKey]
+	if !ok {
+		p = &peerLimits{bucket: newTokenBucket(s.maxForwardsPerSecond)}
+		s.peers[pubKey] = p
+	}
+	return p
+}
+
+// ReserveHtlc attempts to admit an in-flight HTLC of amt on behalf of
+// pubKey, checking the global in-flight count, in-flight value, and
+// forwards-per-second limits. It returns a TemporaryChannelFailure if
+// admitting the HTLC would breach any of them.
+//
+// NOTE: This is part of the InFlightAggregator interface.
+func (s *SwitchRateLimiter) ReserveHtlc(pubKey [33]byte,
+	amt lnwire.MilliSatoshi) lnwire.FailureMessage {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.peerFor(pubKey)
+
+	if s.maxInFlightHtlcs > 0 && p.count >= s.maxInFlightHtlcs {
+		return &lnwire.FailTemporaryChannelFailure{}
+	}
+	if s.maxInFlightValue > 0 && p.value+amt > s.maxInFlightValue {
+		return &lnwire.FailTemporaryChannelFailure{}
+	}
+	if s.maxForwardsPerSecond > 0 && !p.bucket.take() {
+		return &lnwire.FailTemporaryChannelFailure{}
+	}
+
+	p.count++
+	p.value += amt
+
+	return nil
+}
+
+// ReleaseHtlc releases a previously reserved in-flight HTLC for pubKey.
+//
+// NOTE: This is part of the InFlightAggregator interface.
+func (s *SwitchRateLimiter) ReleaseHtlc(pubKey [33]byte, amt lnwire.MilliSatoshi) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.peers[pubKey]
+	if !ok {
+		return
+	}
+
+	if p.count > 0 {
+		p.count--
+	}
+	if p.value > amt {
+		p.value -= amt
+	} else {
+		p.value = 0
+	}
+}
+
+// A compile-time check that SwitchRateLimiter implements InFlightAggregator.
+var _ InFlightAggregator = (*SwitchRateLimiter)(nil)
@@ -0,0 +1,162 @@
+package htlcswitch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BTCGPU/lnd/lnwire"
+)
+
+// TestLinkInFlightCounter asserts that Add/Remove track in-flight count and
+// value the way a link would drive them from ADD and SETTLE/FAIL events.
+func TestLinkInFlightCounter(t *testing.T) {
+	var counter LinkInFlightCounter
+
+	counter.Add(1000)
+	counter.Add(2000)
+
+	count, value := counter.Counts()
+	if count != 2 || value != 3000 {
+		t.Fatalf("unexpected counts after add: count=%d value=%d",
+			count, value)
+	}
+
+	counter.Remove(1000)
+
+	count, value = counter.Counts()
+	if count != 1 || value != 2000 {
+		t.Fatalf("unexpected counts after remove: count=%d value=%d",
+			count, value)
+	}
+}
+
+// TestSwitchRateLimiterMaxInFlightHtlcs asserts that ReserveHtlc rejects a
+// peer once its in-flight HTLC count reaches the configured limit, and
+// admits again once ReleaseHtlc frees up room.
+func TestSwitchRateLimiterMaxInFlightHtlcs(t *testing.T) {
+	limiter := NewSwitchRateLimiter(2, 0, 0)
+
+	var peer [33]byte
+	peer[0] = 0x01
+
+	if fail := limiter.ReserveHtlc(peer, 100); fail != nil {
+		t.Fatalf("unexpected rejection: %v", fail)
+	}
+	if fail := limiter.ReserveHtlc(peer, 100); fail != nil {
+		t.Fatalf("unexpected rejection: %v", fail)
+	}
+	if fail := limiter.ReserveHtlc(peer, 100); fail == nil {
+		t.Fatalf("expected rejection once the in-flight count limit is hit")
+	}
+
+	limiter.ReleaseHtlc(peer, 100)
+
+	if fail := limiter.ReserveHtlc(peer, 100); fail != nil {
+		t.Fatalf("expected admission after a release freed up room: %v", fail)
+	}
+}
+
+// TestSwitchRateLimiterMaxInFlightValue asserts that ReserveHtlc rejects an
+// HTLC that would push a peer's in-flight value over the configured limit.
+func TestSwitchRateLimiterMaxInFlightValue(t *testing.T) {
+	limiter := NewSwitchRateLimiter(0, lnwire.MilliSatoshi(1500), 0)
+
+	var peer [33]byte
+	peer[0] = 0x02
+
+	if fail := limiter.ReserveHtlc(peer, 1000); fail != nil {
+		t.Fatalf("unexpected rejection: %v", fail)
+	}
+	if fail := limiter.ReserveHtlc(peer, 1000); fail == nil {
+		t.Fatalf("expected rejection once the in-flight value limit is hit")
+	}
+}
+
+// TestSwitchRateLimiterForwardsPerSecond asserts that the token bucket
+// rejects bursts beyond its capacity and replenishes over time.
+func TestSwitchRateLimiterForwardsPerSecond(t *testing.T) {
+	limiter := NewSwitchRateLimiter(0, 0, 10)
+
+	var peer [33]byte
+	peer[0] = 0x03
+
+	admitted := 0
+	for i := 0; i < 20; i++ {
+		if fail := limiter.ReserveHtlc(peer, 1); fail == nil {
+			admitted++
+		}
+	}
+	if admitted > 10 {
+		t.Fatalf("expected the burst to be capped near the bucket size, admitted %d", admitted)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if fail := limiter.ReserveHtlc(peer, 1); fail != nil {
+		t.Fatalf("expected the bucket to have refilled after waiting: %v", fail)
+	}
+}
+
+// TestSwitchRateLimiterSetLimitsExistingPeer asserts that raising an active
+// rate limit via SetLimits takes effect for a peer whose token bucket was
+// already created, not just for peers created afterward.
+func TestSwitchRateLimiterSetLimitsExistingPeer(t *testing.T) {
+	limiter := NewSwitchRateLimiter(0, 0, 1)
+
+	var peer [33]byte
+	peer[0] = 0x04
+
+	// Create the peer's bucket at the initial rate of 1/sec, and drain
+	// its single token.
+	if fail := limiter.ReserveHtlc(peer, 1); fail != nil {
+		t.Fatalf("unexpected rejection: %v", fail)
+	}
+	if fail := limiter.ReserveHtlc(peer, 1); fail == nil {
+		t.Fatalf("expected the rate=1 bucket to be empty")
+	}
+
+	// Raising the rate should let the already-existing peer's drained
+	// bucket refill at the new rate: 20ms at 1000/sec yields ~20 tokens,
+	// whereas the old rate of 1/sec would yield none.
+	limiter.SetLimits(0, 0, 1000)
+
+	time.Sleep(20 * time.Millisecond)
+
+	admitted := 0
+	for i := 0; i < 20; i++ {
+		if fail := limiter.ReserveHtlc(peer, 1); fail == nil {
+			admitted++
+		}
+	}
+	if admitted < 10 {
+		t.Fatalf("expected the raised rate to admit a burst, admitted %d", admitted)
+	}
+}
+
+// TestSwitchRateLimiterEnableRateForExistingPeer asserts that turning the
+// forwards-per-second limit on for the first time, after a peer already
+// exists with no limit, does not permanently stick that peer at a stale
+// zero-rate bucket.
+func TestSwitchRateLimiterEnableRateForExistingPeer(t *testing.T) {
+	limiter := NewSwitchRateLimiter(0, 0, 0)
+
+	var peer [33]byte
+	peer[0] = 0x05
+
+	// With no rate limit configured, the peer's bucket is created but
+	// never consulted.
+	for i := 0; i < 5; i++ {
+		if fail := limiter.ReserveHtlc(peer, 1); fail != nil {
+			t.Fatalf("unexpected rejection with no rate limit: %v", fail)
+		}
+	}
+
+	limiter.SetLimits(0, 0, 10)
+
+	time.Sleep(200 * time.Millisecond)
+
+	if fail := limiter.ReserveHtlc(peer, 1); fail != nil {
+		t.Fatalf("expected the newly-enabled rate limit to admit and "+
+			"refill rather than sticking at zero: %v", fail)
+	}
+}